@@ -0,0 +1,349 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stationState caches the most recent fetch outcome for a single station, so
+// that concurrent scrapes within the cache TTL don't re-query upstream.
+type stationState struct {
+	mu             sync.Mutex
+	fetchedAt      time.Time
+	fetchDuration  time.Duration
+	data           *DatiOggi
+	up             bool
+	cacheUpdatedAt time.Time
+}
+
+// meteoCollector is a prometheus.Collector that fetches MeteoTrentino data
+// on demand when scraped, caching each station's result for at most
+// interval (so we don't exceed upstream's 15-minute update cadence),
+// instead of mutating global gauges on a background ticker.
+type meteoCollector struct {
+	// stations is the static station list, used when near is nil.
+	stations []station
+	interval time.Duration
+
+	// near, when set, re-resolves the station list from registry on every
+	// Collect instead of using the static stations above, so that
+	// -auto-discover-interval refreshes are picked up without a restart.
+	near *nearSelector
+
+	// registry is optional; when set by -auto-discover, its contents are
+	// exposed as the meteotrentino_station_info one-shot metric.
+	registry *stationRegistry
+
+	cacheMu sync.Mutex
+	cache   map[string]*stationState
+
+	tempDesc                   *prometheus.Desc
+	rainDesc                   *prometheus.Desc
+	humidityDesc               *prometheus.Desc
+	windSpeedDesc              *prometheus.Desc
+	windDirectionDesc          *prometheus.Desc
+	pressureDesc               *prometheus.Desc
+	snowDepthDesc              *prometheus.Desc
+	solarRadiationDesc         *prometheus.Desc
+	upDesc                     *prometheus.Desc
+	stationsUpDesc             *prometheus.Desc
+	lastRefreshTimeDesc        *prometheus.Desc
+	lastRefreshDurationDesc    *prometheus.Desc
+	cacheUpdatedTimeDesc       *prometheus.Desc
+	refreshIntervalSecondsDesc *prometheus.Desc
+	stationInfoDesc            *prometheus.Desc
+}
+
+func newMeteoCollector(stations []station, interval time.Duration) *meteoCollector {
+	stationLabels := []string{"station_code", "place"}
+	return &meteoCollector{
+		stations: stations,
+		interval: interval,
+		cache:    make(map[string]*stationState),
+
+		tempDesc: prometheus.NewDesc(
+			"temperature_celsius",
+			"Current outside temperature in degrees Celsius",
+			stationLabels, nil,
+		),
+		rainDesc: prometheus.NewDesc(
+			"rain_mm",
+			"Amount of rain in the last period in mm",
+			stationLabels, nil,
+		),
+		humidityDesc: prometheus.NewDesc(
+			"humidity_percent",
+			"Relative himidity in percentage",
+			stationLabels, nil,
+		),
+		windSpeedDesc: prometheus.NewDesc(
+			"wind_speed_mps",
+			"Current wind speed in meters per second",
+			stationLabels, nil,
+		),
+		windDirectionDesc: prometheus.NewDesc(
+			"wind_direction_degrees",
+			"Current wind direction in degrees",
+			stationLabels, nil,
+		),
+		pressureDesc: prometheus.NewDesc(
+			"pressure_hpa",
+			"Current atmospheric pressure in hectopascals",
+			stationLabels, nil,
+		),
+		snowDepthDesc: prometheus.NewDesc(
+			"snow_depth_cm",
+			"Current snow depth in centimeters",
+			stationLabels, nil,
+		),
+		solarRadiationDesc: prometheus.NewDesc(
+			"solar_radiation_wm2",
+			"Current solar radiation in watts per square meter",
+			stationLabels, nil,
+		),
+		upDesc: prometheus.NewDesc(
+			"meteotrentino_up",
+			"Whether the last scrape of this station succeeded (1) or not (0)",
+			stationLabels, nil,
+		),
+		stationsUpDesc: prometheus.NewDesc(
+			"stations_up",
+			"Number of stations successfully queried in the last scrape",
+			nil, nil,
+		),
+		lastRefreshTimeDesc: prometheus.NewDesc(
+			"meteotrentino_last_refresh_time",
+			"Unix timestamp of the last scrape attempt for this station",
+			stationLabels, nil,
+		),
+		lastRefreshDurationDesc: prometheus.NewDesc(
+			"meteotrentino_last_refresh_duration_seconds",
+			"Duration in seconds of the last scrape attempt for this station",
+			stationLabels, nil,
+		),
+		cacheUpdatedTimeDesc: prometheus.NewDesc(
+			"meteotrentino_cache_updated_time",
+			"Unix timestamp of the most recent upstream Data field among this station's series",
+			stationLabels, nil,
+		),
+		refreshIntervalSecondsDesc: prometheus.NewDesc(
+			"meteotrentino_refresh_interval_seconds",
+			"Configured minimum interval in seconds between upstream refreshes (-intervallo)",
+			nil, nil,
+		),
+		stationInfoDesc: prometheus.NewDesc(
+			"meteotrentino_station_info",
+			"One-shot information about a station known to the -auto-discover station registry",
+			[]string{"station_code", "place", "lat", "lon", "elevation_m", "province"}, nil,
+		),
+	}
+}
+
+func (c *meteoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tempDesc
+	ch <- c.rainDesc
+	ch <- c.humidityDesc
+	ch <- c.windSpeedDesc
+	ch <- c.windDirectionDesc
+	ch <- c.pressureDesc
+	ch <- c.snowDepthDesc
+	ch <- c.solarRadiationDesc
+	ch <- c.upDesc
+	ch <- c.stationsUpDesc
+	ch <- c.lastRefreshTimeDesc
+	ch <- c.lastRefreshDurationDesc
+	ch <- c.cacheUpdatedTimeDesc
+	ch <- c.refreshIntervalSecondsDesc
+	ch <- c.stationInfoDesc
+}
+
+// stateFor returns the cached state for a station, refreshing it from
+// upstream first if the cache is empty or older than c.interval.
+func (c *meteoCollector) stateFor(s station) *stationState {
+	c.cacheMu.Lock()
+	st, ok := c.cache[s.code]
+	if !ok {
+		st = &stationState{}
+		c.cache[s.code] = st
+	}
+	c.cacheMu.Unlock()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if time.Since(st.fetchedAt) < c.interval {
+		return st
+	}
+
+	start := time.Now()
+	data, err := getRealTimeData(s.code)
+	st.fetchedAt = start
+	st.fetchDuration = time.Since(start)
+	if err != nil {
+		st.up = false
+		return st
+	}
+	st.data = data
+	st.up = true
+	st.cacheUpdatedAt = lastSampleTime(data)
+	return st
+}
+
+// lastSampleTime returns the most recent "Data" timestamp across the
+// series in item, used as the upstream cache-freshness indicator.
+func lastSampleTime(item *DatiOggi) time.Time {
+	var latest time.Time
+	if s := item.Temperature.TemperaturaAria; len(s) > 0 {
+		latest = s[len(s)-1].Data.Time
+	}
+	if s := item.Precipitazioni.Precipitazione; len(s) > 0 {
+		if t := s[len(s)-1].Data.Time; t.After(latest) {
+			latest = t
+		}
+	}
+	if s := item.Umidita.Umidita; len(s) > 0 {
+		if t := s[len(s)-1].Data.Time; t.After(latest) {
+			latest = t
+		}
+	}
+	if s := item.Vento.VentoVelDir; len(s) > 0 {
+		if t := s[len(s)-1].Data.Time; t.After(latest) {
+			latest = t
+		}
+	}
+	if s := item.Pressione.Pressione; len(s) > 0 {
+		if t := s[len(s)-1].Data.Time; t.After(latest) {
+			latest = t
+		}
+	}
+	if s := item.Neve.AltezzaNeve; len(s) > 0 {
+		if t := s[len(s)-1].Data.Time; t.After(latest) {
+			latest = t
+		}
+	}
+	if s := item.Radiazione.RadiazioneGlobale; len(s) > 0 {
+		if t := s[len(s)-1].Data.Time; t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+func (c *meteoCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.refreshIntervalSecondsDesc, prometheus.GaugeValue, c.interval.Seconds())
+
+	if c.registry != nil {
+		for _, info := range c.registry.all() {
+			ch <- prometheus.MustNewConstMetric(c.stationInfoDesc, prometheus.GaugeValue, 1,
+				info.Codice, info.Nome,
+				strconv.FormatFloat(info.Lat, 'f', -1, 64),
+				strconv.FormatFloat(info.Lon, 'f', -1, 64),
+				strconv.FormatFloat(info.Quota, 'f', -1, 64),
+				info.Provincia,
+			)
+		}
+	}
+
+	stations := c.stations
+	if c.near != nil {
+		if c.registry == nil {
+			logger.Warn("-near is set but no station registry is configured; falling back to the static station list")
+		} else {
+			stations = stationsFromRegistry(c.registry.near(c.near.lat, c.near.lon, c.near.radiusKm))
+		}
+	}
+
+	var upCount atomic.Int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentStations)
+	for _, s := range stations {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(s station) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if c.collectStation(ch, s) {
+				upCount.Add(1)
+			}
+		}(s)
+	}
+	wg.Wait()
+	ch <- prometheus.MustNewConstMetric(c.stationsUpDesc, prometheus.GaugeValue, float64(upCount.Load()))
+}
+
+// collectStation emits every per-station metric for s and reports whether
+// the station's last scrape succeeded, for the stations_up aggregate.
+func (c *meteoCollector) collectStation(ch chan<- prometheus.Metric, s station) bool {
+	st := c.stateFor(s)
+	st.mu.Lock()
+	data, up, fetchedAt, fetchDuration, cacheUpdatedAt := st.data, st.up, st.fetchedAt, st.fetchDuration, st.cacheUpdatedAt
+	st.mu.Unlock()
+
+	upValue := 0.0
+	if up {
+		upValue = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, upValue, s.code, s.place)
+	if !fetchedAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastRefreshTimeDesc, prometheus.GaugeValue, float64(fetchedAt.Unix()), s.code, s.place)
+		ch <- prometheus.MustNewConstMetric(c.lastRefreshDurationDesc, prometheus.GaugeValue, fetchDuration.Seconds(), s.code, s.place)
+	}
+	if !cacheUpdatedAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.cacheUpdatedTimeDesc, prometheus.GaugeValue, float64(cacheUpdatedAt.Unix()), s.code, s.place)
+	}
+
+	if data == nil {
+		return up
+	}
+
+	now := time.Now()
+	lastAcceptableTimestamp := now.Add(-30 * time.Minute)
+
+	if value, sampleTime, err := refreshTemp(data.Temperature.TemperaturaAria, lastAcceptableTimestamp); err != nil {
+		logMetricError("temperature", s.code, sampleTime, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.tempDesc, prometheus.GaugeValue, value, s.code, s.place)
+	}
+
+	if value, sampleTime, err := refreshRain(data.Precipitazioni.Precipitazione, lastAcceptableTimestamp); err != nil {
+		logMetricError("rain", s.code, sampleTime, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.rainDesc, prometheus.GaugeValue, value, s.code, s.place)
+	}
+
+	if value, sampleTime, err := refreshHum(data.Umidita.Umidita, lastAcceptableTimestamp); err != nil {
+		logMetricError("humidity", s.code, sampleTime, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.humidityDesc, prometheus.GaugeValue, value, s.code, s.place)
+	}
+
+	if speed, direction, sampleTime, err := refreshWind(data.Vento.VentoVelDir, lastAcceptableTimestamp); err != nil {
+		logMetricError("wind", s.code, sampleTime, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.windSpeedDesc, prometheus.GaugeValue, speed, s.code, s.place)
+		ch <- prometheus.MustNewConstMetric(c.windDirectionDesc, prometheus.GaugeValue, direction, s.code, s.place)
+	}
+
+	if value, sampleTime, err := refreshPressure(data.Pressione.Pressione, lastAcceptableTimestamp); err != nil {
+		logMetricError("pressure", s.code, sampleTime, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.pressureDesc, prometheus.GaugeValue, value, s.code, s.place)
+	}
+
+	if value, sampleTime, err := refreshSnow(data.Neve.AltezzaNeve, lastAcceptableTimestamp); err != nil {
+		logMetricError("snow", s.code, sampleTime, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.snowDepthDesc, prometheus.GaugeValue, value, s.code, s.place)
+	}
+
+	if value, sampleTime, err := refreshSolar(data.Radiazione.RadiazioneGlobale, lastAcceptableTimestamp); err != nil {
+		logMetricError("solar_radiation", s.code, sampleTime, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.solarRadiationDesc, prometheus.GaugeValue, value, s.code, s.place)
+	}
+
+	return up
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const listaStazioniURLFmt = "%s://dati.meteotrentino.it/service.asmx/listaStazioni"
+
+// earthRadiusKm is used to turn angular distances into kilometers for the
+// -near haversine selector.
+const earthRadiusKm = 6371.0
+
+// stazioneInfo is a single entry of the MeteoTrentino station registry, as
+// returned by listaStazioni.
+type stazioneInfo struct {
+	Codice    string  `xml:"codice"`
+	Nome      string  `xml:"nome"`
+	Lat       float64 `xml:"lat"`
+	Lon       float64 `xml:"lon"`
+	Quota     float64 `xml:"quota"`
+	Provincia string  `xml:"provincia"`
+}
+
+type listaStazioni struct {
+	Stazione []stazioneInfo `xml:"stazione"`
+}
+
+func getStationRegistry() (*listaStazioni, error) {
+	url := fmt.Sprintf(listaStazioniURLFmt, *urlSchema)
+	res, err := http.Get(url)
+	if err != nil {
+		logger.Warn("HTTP request to listaStazioni failed", "error", err)
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		logger.Warn("Failed to read listaStazioni response body", "http_status", res.StatusCode, "error", err)
+		return nil, err
+	}
+	if res.StatusCode > 299 {
+		err = fmt.Errorf(
+			"Response failed with status code: %d and\nbody: %s\n", res.StatusCode, body)
+		logger.Warn("Unexpected listaStazioni HTTP status", "http_status", res.StatusCode, "error", err)
+		return nil, err
+	}
+
+	reg := &listaStazioni{}
+	if err := xml.Unmarshal(body, reg); err != nil {
+		logger.Error("Failed to parse listaStazioni XML response", "error", err)
+		return nil, err
+	}
+	logger.Debug("Received and parsed station registry", "stations", len(reg.Stazione))
+	return reg, nil
+}
+
+// stationRegistry caches the MeteoTrentino station anagraphic data fetched
+// by -auto-discover, so that place labels and the -near selector can be
+// resolved without re-fetching listaStazioni on every lookup.
+type stationRegistry struct {
+	mu       sync.RWMutex
+	byCode   map[string]stazioneInfo
+	stations []stazioneInfo
+}
+
+func newStationRegistry() *stationRegistry {
+	return &stationRegistry{byCode: make(map[string]stazioneInfo)}
+}
+
+// refresh re-fetches listaStazioni and replaces the cached registry.
+func (r *stationRegistry) refresh() error {
+	reg, err := getStationRegistry()
+	if err != nil {
+		return err
+	}
+	byCode := make(map[string]stazioneInfo, len(reg.Stazione))
+	for _, s := range reg.Stazione {
+		byCode[s.Codice] = s
+	}
+	r.mu.Lock()
+	r.byCode = byCode
+	r.stations = reg.Stazione
+	r.mu.Unlock()
+	return nil
+}
+
+// lookup returns the registry entry for a station code, if known.
+func (r *stationRegistry) lookup(code string) (stazioneInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info, ok := r.byCode[code]
+	return info, ok
+}
+
+// all returns a snapshot of every station known to the registry.
+func (r *stationRegistry) all() []stazioneInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]stazioneInfo(nil), r.stations...)
+}
+
+// near returns every registry station within radiusKm of (lat, lon).
+func (r *stationRegistry) near(lat, lon, radiusKm float64) []stazioneInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var found []stazioneInfo
+	for _, s := range r.stations {
+		if haversineKm(lat, lon, s.Lat, s.Lon) <= radiusKm {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// haversineKm returns the great-circle distance in kilometers between two
+// lat/lon points in degrees.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadiusKm * c
+}
+
+// nearSelector is a parsed -near=lat,lon,radius_km flag value.
+type nearSelector struct {
+	lat, lon, radiusKm float64
+}
+
+// parseNearSelector parses "lat,lon,radius_km" as used by -near.
+func parseNearSelector(value string) (nearSelector, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return nearSelector{}, fmt.Errorf("expected lat,lon,radius_km, got %q", value)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nearSelector{}, fmt.Errorf("invalid latitude in %q: %w", value, err)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nearSelector{}, fmt.Errorf("invalid longitude in %q: %w", value, err)
+	}
+	radiusKm, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+	if err != nil {
+		return nearSelector{}, fmt.Errorf("invalid radius in %q: %w", value, err)
+	}
+	return nearSelector{lat: lat, lon: lon, radiusKm: radiusKm}, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{name: "same point is zero distance", lat1: 46.0679, lon1: 11.1211, lat2: 46.0679, lon2: 11.1211, want: 0},
+		{name: "Trento to Rovereto is about 21km", lat1: 46.0679, lon1: 11.1211, lat2: 45.8909, lon2: 11.0404, want: 20.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := haversineKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			if math.Abs(got-tt.want) > 1 {
+				t.Errorf("haversineKm(%v, %v, %v, %v) = %v, want ~%v", tt.lat1, tt.lon1, tt.lat2, tt.lon2, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNearSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    nearSelector
+		wantErr bool
+	}{
+		{name: "valid selector", value: "46.0679,11.1211,10", want: nearSelector{lat: 46.0679, lon: 11.1211, radiusKm: 10}},
+		{name: "valid selector with spaces", value: "46.0679, 11.1211, 10", want: nearSelector{lat: 46.0679, lon: 11.1211, radiusKm: 10}},
+		{name: "missing fields", value: "46.0679,11.1211", wantErr: true},
+		{name: "non-numeric latitude", value: "abc,11.1211,10", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNearSelector(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseNearSelector(%q) error = nil, want error", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNearSelector(%q) unexpected error: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseNearSelector(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
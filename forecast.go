@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const previsioneURLFmt = "%s://dati.meteotrentino.it/service.asmx/previsioneOpenData"
+
+// zoneList collects repeated -zona flag occurrences into a zone code list.
+type zoneList []string
+
+func (z *zoneList) String() string {
+	return strings.Join(*z, ",")
+}
+
+func (z *zoneList) Set(value string) error {
+	*z = append(*z, value)
+	return nil
+}
+
+var (
+	zoneFlag         zoneList
+	toggleForecast   = flag.Bool("forecast", false, "Abilita il sottosistema di previsione (previsioneOpenData)")
+	forecastInterval = flag.Duration("forecast-interval", 6*time.Hour, "Intervallo di aggiornamento delle previsioni, indipendente da -intervallo")
+)
+
+func init() {
+	flag.Var(&zoneFlag, "zona", "Codice zona di previsione da esportare (ripetibile); se omesso vengono esportate tutte le zone")
+}
+
+// GiornoPrevisione is a single forecast day for a zone, as returned by
+// previsioneOpenData.
+type GiornoPrevisione struct {
+	Giorno                    int     `xml:"giorno,attr"`
+	TMin                      float64 `xml:"tmin"`
+	TMax                      float64 `xml:"tmax"`
+	ProbabilitaPrecipitazione float64 `xml:"probabilita_precipitazione"`
+	Precipitazione            float64 `xml:"precipitazione_mm"`
+}
+
+type PrevisioneZona struct {
+	Codice string             `xml:"codice"`
+	Giorni []GiornoPrevisione `xml:"giorno"`
+}
+
+type PrevisioneOpenData struct {
+	Zone []PrevisioneZona `xml:"zona"`
+}
+
+func getForecastData() (*PrevisioneOpenData, error) {
+	url := fmt.Sprintf(previsioneURLFmt, *urlSchema)
+	res, err := http.Get(url)
+	if err != nil {
+		logger.Warn("HTTP request to previsioneOpenData failed", "error", err)
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		logger.Warn("Failed to read previsioneOpenData response body", "http_status", res.StatusCode, "error", err)
+		return nil, err
+	}
+	if res.StatusCode > 299 {
+		err = fmt.Errorf(
+			"Response failed with status code: %d and\nbody: %s\n", res.StatusCode, body)
+		logger.Warn("Unexpected previsioneOpenData HTTP status", "http_status", res.StatusCode, "error", err)
+		return nil, err
+	}
+
+	data := &PrevisioneOpenData{}
+	if err := xml.Unmarshal(body, data); err != nil {
+		logger.Error("Failed to parse previsioneOpenData XML response", "error", err)
+		return nil, err
+	}
+	logger.Debug("Received and parsed forecast data", "zones", len(data.Zone))
+	return data, nil
+}
+
+// forecastCollector is a prometheus.Collector exposing previsioneOpenData,
+// refreshed on its own cadence (-forecast-interval) independent of the
+// real-time stations' -intervallo, since forecasts only update a few times
+// a day.
+type forecastCollector struct {
+	zones    []string
+	interval time.Duration
+
+	mu        sync.Mutex
+	fetchedAt time.Time
+	data      *PrevisioneOpenData
+
+	tMinDesc       *prometheus.Desc
+	tMaxDesc       *prometheus.Desc
+	precipProbDesc *prometheus.Desc
+	precipMmDesc   *prometheus.Desc
+}
+
+func newForecastCollector(zones []string, interval time.Duration) *forecastCollector {
+	forecastLabels := []string{"zone", "forecast_offset_hours"}
+	return &forecastCollector{
+		zones:    zones,
+		interval: interval,
+		tMinDesc: prometheus.NewDesc(
+			"meteotrentino_forecast_temperature_min_celsius",
+			"Forecast minimum temperature in degrees Celsius for the given offset",
+			forecastLabels, nil,
+		),
+		tMaxDesc: prometheus.NewDesc(
+			"meteotrentino_forecast_temperature_max_celsius",
+			"Forecast maximum temperature in degrees Celsius for the given offset",
+			forecastLabels, nil,
+		),
+		precipProbDesc: prometheus.NewDesc(
+			"meteotrentino_forecast_precipitation_probability_percent",
+			"Forecast probability of precipitation in percent for the given offset",
+			forecastLabels, nil,
+		),
+		precipMmDesc: prometheus.NewDesc(
+			"meteotrentino_forecast_precipitation_mm",
+			"Forecast precipitation amount in mm for the given offset",
+			forecastLabels, nil,
+		),
+	}
+}
+
+func (c *forecastCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tMinDesc
+	ch <- c.tMaxDesc
+	ch <- c.precipProbDesc
+	ch <- c.precipMmDesc
+}
+
+// wanted reports whether zone should be exported, honouring -zona filters.
+func (c *forecastCollector) wanted(zone string) bool {
+	if len(c.zones) == 0 {
+		return true
+	}
+	for _, z := range c.zones {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *forecastCollector) refreshIfStale() *PrevisioneOpenData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.fetchedAt) < c.interval {
+		return c.data
+	}
+	c.fetchedAt = time.Now()
+	if data, err := getForecastData(); err == nil {
+		c.data = data
+	}
+	return c.data
+}
+
+func (c *forecastCollector) Collect(ch chan<- prometheus.Metric) {
+	data := c.refreshIfStale()
+	if data == nil {
+		return
+	}
+	for _, zone := range data.Zone {
+		if !c.wanted(zone.Codice) {
+			continue
+		}
+		for _, g := range zone.Giorni {
+			offsetHours := fmt.Sprintf("%d", g.Giorno*24)
+			ch <- prometheus.MustNewConstMetric(c.tMinDesc, prometheus.GaugeValue, g.TMin, zone.Codice, offsetHours)
+			ch <- prometheus.MustNewConstMetric(c.tMaxDesc, prometheus.GaugeValue, g.TMax, zone.Codice, offsetHours)
+			ch <- prometheus.MustNewConstMetric(c.precipProbDesc, prometheus.GaugeValue, g.ProbabilitaPrecipitazione, zone.Codice, offsetHours)
+			ch <- prometheus.MustNewConstMetric(c.precipMmDesc, prometheus.GaugeValue, g.Precipitazione, zone.Codice, offsetHours)
+		}
+	}
+}
@@ -6,17 +6,21 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const urlFmt = "%s://dati.meteotrentino.it/service.asmx/ultimiDatiStazione?codice=%s"
 
+// maxConcurrentStations bounds how many stations we query at once, so we
+// don't hammer dati.meteotrentino.it when a lot of stations are configured.
+const maxConcurrentStations = 4
+
 type LocalTime struct {
 	time.Time
 }
@@ -54,55 +58,150 @@ type UmiditaList struct {
 	Umidita []UmiditaRelativa `xml:"umidita_relativa"`
 }
 
+type VentoVelDir struct {
+	Data      LocalTime `xml:"data"`
+	Velocita  float64   `xml:"velocita"`
+	UM        string    `xml:"UM,attr"`
+	Direzione float64   `xml:"direzione"`
+}
+type Vento struct {
+	VentoVelDir []VentoVelDir `xml:"vento_vel_dir"`
+}
+
+type Pressione struct {
+	Data      LocalTime `xml:"data"`
+	Pressione float64   `xml:"pressione"`
+	UM        string    `xml:"UM,attr"`
+}
+type PressioneList struct {
+	Pressione []Pressione `xml:"pressione"`
+}
+
+type AltezzaNeve struct {
+	Data    LocalTime `xml:"data"`
+	Altezza float64   `xml:"altezza_neve"`
+	UM      string    `xml:"UM,attr"`
+}
+type NeveList struct {
+	AltezzaNeve []AltezzaNeve `xml:"altezza_neve"`
+}
+
+type RadiazioneGlobale struct {
+	Data       LocalTime `xml:"data"`
+	Radiazione float64   `xml:"radiazione_globale"`
+	UM         string    `xml:"UM,attr"`
+}
+type RadiazioneList struct {
+	RadiazioneGlobale []RadiazioneGlobale `xml:"radiazione_globale"`
+}
+
 type DatiOggi struct {
 	Temperature    Temperature    `xml:"temperature"`
 	Precipitazioni Precipitazioni `xml:"precipitazioni"`
 	Umidita        UmiditaList    `xml:"umidita_relativa"`
+	Vento          Vento          `xml:"vento"`
+	Pressione      PressioneList  `xml:"pressione"`
+	Neve           NeveList       `xml:"neve"`
+	Radiazione     RadiazioneList `xml:"radiazione"`
 }
 
+// station is a single configured weather station, identified by its
+// MeteoTrentino code and the friendly place name we attach as a label.
+type station struct {
+	code  string
+	place string
+}
+
+// stazioni collects repeated -stazione flag occurrences into a station list.
+type stazioni []string
+
+func (s *stazioni) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stazioni) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// defaultStationCode is used when no -stazione and no -near selector are
+// configured, matching the exporter's historical single-station behaviour.
+const defaultStationCode = "T0147"
+
+// defaultStationPlace is the fallback place label when -localita is omitted
+// and the station isn't found in the (optional) station registry.
+const defaultStationPlace = "Rovereto"
+
 var (
-	codStazione = flag.String("stazione", "T0147", "Codice della stazione meteo, si veda anagrafica http://dati.meteotrentino.it/service.asmx/listaStazioni")
-	locStazione = flag.String("localita", "Rovereto", "Località della stazione meteo")
-	interval    = flag.Duration("intervallo", 60*time.Second, "Intervallo di tempo tra le richieste successive. I dati sono aggiornati alla fonte ogni 15 minuti")
-	listenAddr  = flag.String("listen-addr", ":8089", "Indirizzo di rete su cui esporre il server HTTP")
-	urlSchema   = flag.String("url-schema", "https", "Schema dell'URL da cui ottenere i dati (http o https)")
-	toggleTemp = flag.Bool("temperatura", true, "Abilita o disabilita le temperature")
-	toggleRain = flag.Bool("precipitazione", true, "Abilita o disabilita le precipitazioni")
-	toggleHum = flag.Bool("umidita", true, "Abilita o disabilita l'umidità")
-	url         string
-	errMetricDisabled = errors.New("Metric is disabled")
-	tempMetric  = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "temperature_celsius",
-			Help: "Current outside temperature in degrees Celsius",
-		},
-		[]string{"station_code", "place"},
-	)
-	rainMetric = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "rain_mm",
-			Help: "Amount of rain in the last period in mm",
-		},
-		[]string{"station_code", "place"},
-	)
-	humidityMetric = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "humidity_percent",
-			Help: "Relative himidity in percentage",
-		},
-		[]string{"station_code", "place"},
-	)
-	stationsUpMetric = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "stations_up",
-			Help: "Number of stations successfully queried",
-		},
-	)
+	codStazioni        stazioni
+	locStazione        = flag.String("localita", "", "Località di default per ogni -stazione indicata senza '=Località' (incluso il caso in cui -stazione non sia specificato affatto); se omessa e -auto-discover è attivo viene ricavata dall'anagrafica stazioni")
+	interval           = flag.Duration("intervallo", 60*time.Second, "Intervallo di tempo tra le richieste successive. I dati sono aggiornati alla fonte ogni 15 minuti")
+	listenAddr         = flag.String("listen-addr", ":8089", "Indirizzo di rete su cui esporre il server HTTP")
+	urlSchema          = flag.String("url-schema", "https", "Schema dell'URL da cui ottenere i dati (http o https)")
+	toggleTemp         = flag.Bool("temperatura", true, "Abilita o disabilita le temperature")
+	toggleRain         = flag.Bool("precipitazione", true, "Abilita o disabilita le precipitazioni")
+	toggleHum          = flag.Bool("umidita", true, "Abilita o disabilita l'umidità")
+	toggleWind         = flag.Bool("vento", true, "Abilita o disabilita velocità e direzione del vento")
+	togglePressure     = flag.Bool("pressione", true, "Abilita o disabilita la pressione atmosferica")
+	toggleSnow         = flag.Bool("neve", true, "Abilita o disabilita l'altezza della neve")
+	toggleSolar        = flag.Bool("radiazione", true, "Abilita o disabilita la radiazione solare")
+	toggleAutoDiscover = flag.Bool("auto-discover", false, "Scarica l'anagrafica delle stazioni da listaStazioni per ricavare i nomi delle località e abilitare -near")
+	discoverInterval   = flag.Duration("auto-discover-interval", 0, "Intervallo di aggiornamento periodico dell'anagrafica stazioni (0 = solo all'avvio)")
+	nearFlag           = flag.String("near", "", "Seleziona tutte le stazioni entro radius_km da lat,lon (abilita automaticamente -auto-discover), nel formato lat,lon,radius_km")
+	logLevelFlag       = flag.String("log-level", "info", "Livello minimo di log (debug, info, warn, error)")
+	logFormatFlag      = flag.String("log-format", "logfmt", "Formato di output dei log (logfmt o json)")
+	errMetricDisabled  = errors.New("Metric is disabled")
+	errUnknownUnit     = errors.New("Unknown unit of measure")
+	errNoSamples       = errors.New("No samples in series")
+	errStaleSample     = errors.New("Rejected stale sample")
 )
 
-func getRealTimeData() (item *DatiOggi, err error) {
+func init() {
+	flag.Var(&codStazioni, "stazione", "Codice della stazione meteo, opzionalmente nella forma CODICE=Località (ripetibile). Si veda anagrafica http://dati.meteotrentino.it/service.asmx/listaStazioni")
+}
+
+// parseStations turns the repeatable -stazione flag into a station list,
+// falling back to the legacy single-station default when none was given.
+// When a station's place is omitted, lookupPlace (backed by the station
+// registry when -auto-discover is enabled) is consulted before falling
+// back to defaultPlace.
+func parseStations(raw []string, defaultPlace string, lookupPlace func(code string) (string, bool)) []station {
+	resolvePlace := func(code, place string) string {
+		if place != "" {
+			return place
+		}
+		if name, ok := lookupPlace(code); ok {
+			return name
+		}
+		return defaultPlace
+	}
+
+	if len(raw) == 0 {
+		return []station{{code: defaultStationCode, place: resolvePlace(defaultStationCode, "")}}
+	}
+	stations := make([]station, 0, len(raw))
+	for _, s := range raw {
+		code, place, _ := strings.Cut(s, "=")
+		stations = append(stations, station{code: code, place: resolvePlace(code, place)})
+	}
+	return stations
+}
+
+// stationsFromRegistry turns the registry entries matched by -near into a
+// station list, using the registry's own station name as the place label.
+func stationsFromRegistry(entries []stazioneInfo) []station {
+	stations := make([]station, 0, len(entries))
+	for _, e := range entries {
+		stations = append(stations, station{code: e.Codice, place: e.Nome})
+	}
+	return stations
+}
+
+func getRealTimeData(code string) (item *DatiOggi, err error) {
+	url := fmt.Sprintf(urlFmt, *urlSchema, code)
 	res, err := http.Get(url)
 	if err != nil {
+		logger.Warn("HTTP request to MeteoTrentino failed", "station_code", code, "error", err)
 		return
 	}
 	body, err := io.ReadAll(res.Body)
@@ -112,155 +211,299 @@ func getRealTimeData() (item *DatiOggi, err error) {
 			"Response failed with status code: %d and\nbody: %s\n", res.StatusCode, body)
 	}
 	if err != nil {
+		logger.Warn("HTTP request to MeteoTrentino failed", "station_code", code, "http_status", res.StatusCode, "error", err)
 		return
 	}
 
 	item = &DatiOggi{}
 	err = xml.Unmarshal(body, item)
 	if err != nil {
+		logger.Error("Failed to parse MeteoTrentino XML response", "station_code", code, "error", err)
 		return
 	}
-	log.Println("Received and parsed data")
+	logger.Debug("Received and parsed data", "station_code", code)
 	return
 }
 
-func refreshTemp(s []TemperaturaAria, lastAcceptableTimestamp time.Time) (value float64, err error) {
+func refreshTemp(s []TemperaturaAria, lastAcceptableTimestamp time.Time) (value float64, sampleTime time.Time, err error) {
 	if !*toggleTemp {
 		err = fmt.Errorf("%w: temperature", errMetricDisabled)
 		return
 	}
 	n := len(s)
 	if n < 1 {
-		err = fmt.Errorf("No samples in temperature series")
+		err = fmt.Errorf("%w: no samples in temperature series", errNoSamples)
 		return
 	}
 	last := s[n-1]
-	if !last.Data.Time.After(lastAcceptableTimestamp) {
+	sampleTime = last.Data.Time
+	if !sampleTime.After(lastAcceptableTimestamp) {
 		err = fmt.Errorf(
-			"Rejected stale temperature sample with timestamp %v (current time %v)", last.Data, time.Now().Format(time.RFC3339))
+			"%w: rejected stale temperature sample with timestamp %v (current time %v)", errStaleSample, last.Data, time.Now().Format(time.RFC3339))
 		return
 	}
 	value = last.Temperatura
 	return
 }
 
-func refreshRain(s []Precipitazione, lastAcceptableTimestamp time.Time) (value float64, err error) {
+func refreshRain(s []Precipitazione, lastAcceptableTimestamp time.Time) (value float64, sampleTime time.Time, err error) {
 	if !*toggleRain {
 		err = fmt.Errorf("%w: rain", errMetricDisabled)
 		return
 	}
 	n := len(s)
 	if n < 1 {
-		err = fmt.Errorf("No samples in rain series")
+		err = fmt.Errorf("%w: no samples in rain series", errNoSamples)
 		return
 	}
 	last := s[n-1]
-	if !last.Data.Time.After(lastAcceptableTimestamp) {
+	sampleTime = last.Data.Time
+	if !sampleTime.After(lastAcceptableTimestamp) {
 		err = fmt.Errorf(
-			"Rejected stale rain sample with timestamp %v (current time %v)", last.Data, time.Now().Format(time.RFC3339))
+			"%w: rejected stale rain sample with timestamp %v (current time %v)", errStaleSample, last.Data, time.Now().Format(time.RFC3339))
 		return
 	}
 	value = last.Pioggia
 	return
 }
 
-func refreshHum(s []UmiditaRelativa, lastAcceptableTimestamp time.Time) (value float64, err error) {
+func refreshHum(s []UmiditaRelativa, lastAcceptableTimestamp time.Time) (value float64, sampleTime time.Time, err error) {
 	if !*toggleHum {
 		err = fmt.Errorf("%w: humidity", errMetricDisabled)
 		return
 	}
 	n := len(s)
 	if n < 1 {
-		err = fmt.Errorf("No samples in humidity series")
+		err = fmt.Errorf("%w: no samples in humidity series", errNoSamples)
 		return
 	}
 	last := s[n-1]
-	if !last.Data.Time.After(lastAcceptableTimestamp) {
+	sampleTime = last.Data.Time
+	if !sampleTime.After(lastAcceptableTimestamp) {
 		err = fmt.Errorf(
-			"Rejected stale humidity sample with timestamp %v (current time %v)", last.Data, time.Now().Format(time.RFC3339))
+			"%w: rejected stale humidity sample with timestamp %v (current time %v)", errStaleSample, last.Data, time.Now().Format(time.RFC3339))
 		return
 	}
 	value = last.RH
 	return
 }
 
-func logMetricError(err error) {
-	if !errors.Is(err, errMetricDisabled) { log.Println(err) }
+func refreshWind(s []VentoVelDir, lastAcceptableTimestamp time.Time) (speedMps, directionDegrees float64, sampleTime time.Time, err error) {
+	if !*toggleWind {
+		err = fmt.Errorf("%w: wind", errMetricDisabled)
+		return
+	}
+	n := len(s)
+	if n < 1 {
+		err = fmt.Errorf("%w: no samples in wind series", errNoSamples)
+		return
+	}
+	last := s[n-1]
+	sampleTime = last.Data.Time
+	if !sampleTime.After(lastAcceptableTimestamp) {
+		err = fmt.Errorf(
+			"%w: rejected stale wind sample with timestamp %v (current time %v)", errStaleSample, last.Data, time.Now().Format(time.RFC3339))
+		return
+	}
+	switch last.UM {
+	case "km/h":
+		speedMps = last.Velocita / 3.6
+	case "m/s":
+		speedMps = last.Velocita
+	default:
+		err = fmt.Errorf("%w: %q for wind speed", errUnknownUnit, last.UM)
+		return
+	}
+	directionDegrees = last.Direzione
+	return
 }
 
-func refresh() {
-	labels := prometheus.Labels{
-		"station_code": *codStazione,
-		"place":        *locStazione,
+func refreshPressure(s []Pressione, lastAcceptableTimestamp time.Time) (value float64, sampleTime time.Time, err error) {
+	if !*togglePressure {
+		err = fmt.Errorf("%w: pressure", errMetricDisabled)
+		return
 	}
-	var updated float64 = 0
-	var value float64
-	now := time.Now()
-	lastAcceptableTimestamp := now.Add(-30 * time.Minute)
-
-	o, err := getRealTimeData()
-	if err != nil {
-		log.Println(err)
-		tempMetric.DeletePartialMatch(labels)
-		rainMetric.DeletePartialMatch(labels)
-		humidityMetric.DeletePartialMatch(labels)
-		stationsUpMetric.Set(0)
+	n := len(s)
+	if n < 1 {
+		err = fmt.Errorf("%w: no samples in pressure series", errNoSamples)
 		return
 	}
-	// fmt.Printf("%#v\n", o)
-
-	temps := o.Temperature.TemperaturaAria
-	value, err = refreshTemp(temps, lastAcceptableTimestamp)
-	if err != nil {
-		logMetricError(err)
-		tempMetric.DeletePartialMatch(labels)
-	} else {
-		tempMetric.With(labels).Set(value)
-		updated = 1
+	last := s[n-1]
+	sampleTime = last.Data.Time
+	if !sampleTime.After(lastAcceptableTimestamp) {
+		err = fmt.Errorf(
+			"%w: rejected stale pressure sample with timestamp %v (current time %v)", errStaleSample, last.Data, time.Now().Format(time.RFC3339))
+		return
 	}
+	if last.UM != "hPa" {
+		err = fmt.Errorf("%w: %q for pressure", errUnknownUnit, last.UM)
+		return
+	}
+	value = last.Pressione
+	return
+}
 
-	precs := o.Precipitazioni.Precipitazione
-	value, err = refreshRain(precs, lastAcceptableTimestamp)
-	if err != nil {
-		logMetricError(err)
-		rainMetric.DeletePartialMatch(labels)
-	} else {
-		rainMetric.With(labels).Set(value)
-		updated = 1
+func refreshSnow(s []AltezzaNeve, lastAcceptableTimestamp time.Time) (value float64, sampleTime time.Time, err error) {
+	if !*toggleSnow {
+		err = fmt.Errorf("%w: snow", errMetricDisabled)
+		return
+	}
+	n := len(s)
+	if n < 1 {
+		err = fmt.Errorf("%w: no samples in snow series", errNoSamples)
+		return
+	}
+	last := s[n-1]
+	sampleTime = last.Data.Time
+	if !sampleTime.After(lastAcceptableTimestamp) {
+		err = fmt.Errorf(
+			"%w: rejected stale snow sample with timestamp %v (current time %v)", errStaleSample, last.Data, time.Now().Format(time.RFC3339))
+		return
 	}
+	switch last.UM {
+	case "cm":
+		value = last.Altezza
+	case "m":
+		value = last.Altezza * 100
+	default:
+		err = fmt.Errorf("%w: %q for snow depth", errUnknownUnit, last.UM)
+		return
+	}
+	return
+}
 
-	hums := o.Umidita.Umidita
-	value, err = refreshHum(hums, lastAcceptableTimestamp)
-	if err != nil {
-		logMetricError(err)
-		humidityMetric.DeletePartialMatch(labels)
-	} else {
-		humidityMetric.With(labels).Set(value)
-		updated = 1
+func refreshSolar(s []RadiazioneGlobale, lastAcceptableTimestamp time.Time) (value float64, sampleTime time.Time, err error) {
+	if !*toggleSolar {
+		err = fmt.Errorf("%w: solar radiation", errMetricDisabled)
+		return
 	}
+	n := len(s)
+	if n < 1 {
+		err = fmt.Errorf("%w: no samples in solar radiation series", errNoSamples)
+		return
+	}
+	last := s[n-1]
+	sampleTime = last.Data.Time
+	if !sampleTime.After(lastAcceptableTimestamp) {
+		err = fmt.Errorf(
+			"%w: rejected stale solar radiation sample with timestamp %v (current time %v)", errStaleSample, last.Data, time.Now().Format(time.RFC3339))
+		return
+	}
+	if last.UM != "W/m2" {
+		err = fmt.Errorf("%w: %q for solar radiation", errUnknownUnit, last.UM)
+		return
+	}
+	value = last.Radiazione
+	return
+}
 
-	stationsUpMetric.Set(updated)
+// logMetricError logs a refreshX error with the fields useful to tell a
+// disabled metric or a transient stale sample apart from a genuine upstream
+// problem. Disabled-metric and stale-sample rejections are routine and are
+// logged at debug; anything else (e.g. an unrecognised unit of measure) is
+// logged at warn.
+func logMetricError(metric, stationCode string, sampleTime time.Time, err error) {
+	attrs := []any{"metric", metric, "station_code", stationCode}
+	if !sampleTime.IsZero() {
+		attrs = append(attrs, "sample_ts", sampleTime)
+	}
+	if errors.Is(err, errMetricDisabled) {
+		logger.Debug("Metric disabled", attrs...)
+		return
+	}
+	attrs = append(attrs, "error", err)
+	if errors.Is(err, errStaleSample) {
+		logger.Debug(err.Error(), attrs...)
+		return
+	}
+	// errUnknownUnit (upstream schema drift) and errNoSamples, along with
+	// any other unrecognised failure, are warned about rather than hidden
+	// at debug, since they need an operator's attention.
+	logger.Warn(err.Error(), attrs...)
 }
 
 func main() {
 	flag.Parse()
-	if !(*toggleTemp || *toggleRain || *toggleHum) {
-		log.Println("No metric enabled, closing")
+
+	level, err := parseLogLevel(*logLevelFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	l, err := newLogger(*logFormatFlag, level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger = l
+
+	if !(*toggleTemp || *toggleRain || *toggleHum || *toggleWind || *togglePressure || *toggleSnow || *toggleSolar) {
+		logger.Error("No metric enabled, closing")
 		return
 	}
-	url = fmt.Sprintf(urlFmt, *urlSchema, *codStazione)
-	log.Println("Getting data from", url)
-	go refresh()
-	tick := time.NewTicker(*interval)
-	go func() {
-		for {
-			select {
-			case <-tick.C:
-				refresh()
-			}
+
+	var near *nearSelector
+	if *nearFlag != "" {
+		n, err := parseNearSelector(*nearFlag)
+		if err != nil {
+			logger.Error("Invalid -near selector", "error", err)
+			os.Exit(1)
+		}
+		near = &n
+	}
+
+	var registry *stationRegistry
+	if *toggleAutoDiscover || near != nil {
+		registry = newStationRegistry()
+		if err := registry.refresh(); err != nil {
+			logger.Warn("Initial station registry fetch failed", "error", err)
+		}
+		if *discoverInterval > 0 {
+			go func() {
+				for range time.Tick(*discoverInterval) {
+					if err := registry.refresh(); err != nil {
+						logger.Warn("Station registry refresh failed", "error", err)
+					}
+				}
+			}()
+		}
+	}
+
+	lookupPlace := func(code string) (string, bool) {
+		if registry == nil || *locStazione != "" {
+			return "", false
 		}
-	}()
+		info, ok := registry.lookup(code)
+		return info.Nome, ok
+	}
+	defaultPlace := *locStazione
+	if defaultPlace == "" {
+		defaultPlace = defaultStationPlace
+	}
+
+	var stations []station
+	if near != nil {
+		stations = stationsFromRegistry(registry.near(near.lat, near.lon, near.radiusKm))
+	} else {
+		stations = parseStations(codStazioni, defaultPlace, lookupPlace)
+	}
+	logger.Info("Collecting data", "stations", len(stations), "interval", interval)
+
+	collector := newMeteoCollector(stations, *interval)
+	collector.registry = registry
+	// Resolving -near against the registry on every scrape (rather than
+	// just at startup) means a periodic -auto-discover-interval refresh,
+	// or one that initially failed and later succeeds, is reflected
+	// without restarting the exporter.
+	collector.near = near
+	prometheus.MustRegister(collector)
+
+	if *toggleForecast {
+		logger.Info("Collecting forecast data", "zones", len(zoneFlag), "forecast_interval", forecastInterval)
+		prometheus.MustRegister(newForecastCollector(zoneFlag, *forecastInterval))
+	}
 
 	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(*listenAddr, nil))
+	logger.Error("HTTP server stopped", "error", http.ListenAndServe(*listenAddr, nil))
+	os.Exit(1)
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshWindUnitConversion(t *testing.T) {
+	lastAcceptableTimestamp := time.Now().Add(-30 * time.Minute)
+	sampleTime := LocalTime{Time: time.Now()}
+
+	tests := []struct {
+		name          string
+		um            string
+		velocita      float64
+		wantSpeedMps  float64
+		wantErrSample bool
+	}{
+		{name: "km/h is converted to m/s", um: "km/h", velocita: 36, wantSpeedMps: 10},
+		{name: "m/s passes through unchanged", um: "m/s", velocita: 10, wantSpeedMps: 10},
+		{name: "unknown unit is rejected", um: "mph", velocita: 10, wantErrSample: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := []VentoVelDir{{Data: sampleTime, Velocita: tt.velocita, UM: tt.um, Direzione: 180}}
+			speedMps, _, _, err := refreshWind(s, lastAcceptableTimestamp)
+			if tt.wantErrSample {
+				if !errors.Is(err, errUnknownUnit) {
+					t.Fatalf("refreshWind(%q) error = %v, want errUnknownUnit", tt.um, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("refreshWind(%q) unexpected error: %v", tt.um, err)
+			}
+			if speedMps != tt.wantSpeedMps {
+				t.Errorf("refreshWind(%q) speedMps = %v, want %v", tt.um, speedMps, tt.wantSpeedMps)
+			}
+		})
+	}
+}
+
+func TestParseStations(t *testing.T) {
+	lookupPlace := func(code string) (string, bool) {
+		if code == "T0001" {
+			return "Trento (anagrafica)", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name string
+		raw  []string
+		want []station
+	}{
+		{
+			name: "no stations falls back to the legacy default",
+			raw:  nil,
+			want: []station{{code: defaultStationCode, place: defaultStationPlace}},
+		},
+		{
+			name: "bare station code without '=' uses the default place",
+			raw:  []string{"T0099"},
+			want: []station{{code: "T0099", place: defaultStationPlace}},
+		},
+		{
+			name: "station code with '=Località' uses the explicit place",
+			raw:  []string{"T0099=Mia Località"},
+			want: []station{{code: "T0099", place: "Mia Località"}},
+		},
+		{
+			name: "bare station code known to the registry uses its name",
+			raw:  []string{"T0001"},
+			want: []station{{code: "T0001", place: "Trento (anagrafica)"}},
+		},
+		{
+			name: "multiple stations are resolved independently",
+			raw:  []string{"T0001", "T0099=Mia Località", "T0042"},
+			want: []station{
+				{code: "T0001", place: "Trento (anagrafica)"},
+				{code: "T0099", place: "Mia Località"},
+				{code: "T0042", place: defaultStationPlace},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseStations(tt.raw, defaultStationPlace, lookupPlace)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseStations(%v) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseStations(%v)[%d] = %+v, want %+v", tt.raw, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRefreshSnowUnitConversion(t *testing.T) {
+	lastAcceptableTimestamp := time.Now().Add(-30 * time.Minute)
+	sampleTime := LocalTime{Time: time.Now()}
+
+	tests := []struct {
+		name          string
+		um            string
+		altezza       float64
+		wantValue     float64
+		wantErrSample bool
+	}{
+		{name: "cm passes through unchanged", um: "cm", altezza: 42, wantValue: 42},
+		{name: "m is converted to cm", um: "m", altezza: 1.5, wantValue: 150},
+		{name: "unknown unit is rejected", um: "in", altezza: 1, wantErrSample: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := []AltezzaNeve{{Data: sampleTime, Altezza: tt.altezza, UM: tt.um}}
+			value, _, err := refreshSnow(s, lastAcceptableTimestamp)
+			if tt.wantErrSample {
+				if !errors.Is(err, errUnknownUnit) {
+					t.Fatalf("refreshSnow(%q) error = %v, want errUnknownUnit", tt.um, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("refreshSnow(%q) unexpected error: %v", tt.um, err)
+			}
+			if value != tt.wantValue {
+				t.Errorf("refreshSnow(%q) value = %v, want %v", tt.um, value, tt.wantValue)
+			}
+		})
+	}
+}